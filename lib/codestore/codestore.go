@@ -0,0 +1,155 @@
+// Package codestore content-addresses function payloads on disk, mirroring
+// how container runtimes cache image layers. Instead of a function version
+// carrying its own copy of a zip/tar payload (which forces a full round-trip
+// through TOML and blows up memory for anything larger than a few MB),
+// callers stream the payload once through Store.Put, get back a sha256
+// digest, and reference that digest from as many function versions as they
+// like.
+package codestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/struCoder/pmgo/lib/utils"
+)
+
+// layersDir is the subdirectory of a Store's root where content-addressed
+// layers live.
+const layersDir = "_layers"
+
+// Store content-addresses function payloads under root/_layers/<sha256>/,
+// deduplicating uploads and their extracted contents on disk.
+type Store struct {
+	root string
+}
+
+// NewStore returns a Store that keeps its layers under sysFolder/_layers.
+func NewStore(sysFolder string) *Store {
+	return &Store{root: sysFolder}
+}
+
+// layersPath returns the directory every layer is stored under.
+func (s *Store) layersPath() string {
+	return filepath.Join(s.root, layersDir)
+}
+
+// LayerPath returns the on-disk directory a digest's extracted contents live
+// under, for use by callers that want to hardlink or symlink out of it.
+func (s *Store) LayerPath(digest string) string {
+	return filepath.Join(s.layersPath(), digest, "root")
+}
+
+// archivePath returns the on-disk path of the raw, un-extracted archive for
+// a digest.
+func (s *Store) archivePath(digest string) string {
+	return filepath.Join(s.layersPath(), digest, "archive")
+}
+
+// Put streams r to disk, content-addressing it by sha256, and extracts it
+// once into the layer's root directory. If a layer with the resulting
+// digest already exists, the upload is discarded and the existing layer is
+// reused untouched. Returns the hex-encoded digest.
+func (s *Store) Put(r io.Reader) (string, error) {
+	if err := os.MkdirAll(s.layersPath(), 0755); err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile(s.layersPath(), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	digest := hex.EncodeToString(hasher.Sum(nil))
+	layerDir := filepath.Join(s.layersPath(), digest)
+
+	if _, err := os.Stat(layerDir); err == nil {
+		// Already have this layer extracted; dedupe.
+		return digest, nil
+	}
+
+	if err := os.MkdirAll(layerDir, 0755); err != nil {
+		return "", err
+	}
+
+	archivePath := s.archivePath(digest)
+	if err := os.Rename(tmpPath, archivePath); err != nil {
+		return "", err
+	}
+
+	rootPath := s.LayerPath(digest)
+	if err := os.MkdirAll(rootPath, 0755); err != nil {
+		return "", err
+	}
+	if err := utils.ExtractArchive(archivePath, rootPath); err != nil {
+		os.RemoveAll(layerDir)
+		return "", fmt.Errorf("codestore: error extracting layer %s: %s", digest, err)
+	}
+
+	return digest, nil
+}
+
+// Has reports whether digest has already been stored and extracted.
+func (s *Store) Has(digest string) bool {
+	_, err := os.Stat(s.LayerPath(digest))
+	return err == nil
+}
+
+// LinkInto populates dest with the contents of digest's layer, hardlinking
+// each file so that many function versions can share the same extracted
+// layer cheaply. It falls back to a symlink for any file that can't be
+// hardlinked, e.g. because dest lives on a different filesystem.
+// Returns an error in case there's any, including if digest hasn't been
+// stored.
+func (s *Store) LinkInto(digest, dest string) error {
+	rootPath := s.LayerPath(digest)
+	if _, err := os.Stat(rootPath); err != nil {
+		return fmt.Errorf("codestore: unknown digest %s: %s", digest, err)
+	}
+
+	return filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(rootPath, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		target := filepath.Join(dest, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode())
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		os.Remove(target)
+		if err := os.Link(path, target); err != nil {
+			return os.Symlink(path, target)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+package codestore
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeTestZip builds an in-memory zip archive with a single file entry.
+func makeTestZip(t *testing.T, name, contents string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fw, err := zw.Create(name)
+	if err != nil {
+		t.Fatalf("creating zip entry: %s", err)
+	}
+	if _, err := fw.Write([]byte(contents)); err != nil {
+		t.Fatalf("writing zip entry: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip writer: %s", err)
+	}
+	return &buf
+}
+
+func TestStorePutHasLinkIntoRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	s := NewStore(root)
+
+	digest, err := s.Put(makeTestZip(t, "bootstrap", "#!/bin/sh\necho hi\n"))
+	if err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+	if digest == "" {
+		t.Fatal("Put returned an empty digest")
+	}
+
+	if !s.Has(digest) {
+		t.Fatalf("Has(%s) = false after Put", digest)
+	}
+	if s.Has("0000000000000000000000000000000000000000000000000000000000000000") {
+		t.Fatal("Has reported true for a digest that was never stored")
+	}
+
+	dest := t.TempDir()
+	if err := s.LinkInto(digest, dest); err != nil {
+		t.Fatalf("LinkInto: %s", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dest, "bootstrap"))
+	if err != nil {
+		t.Fatalf("reading linked file: %s", err)
+	}
+	if string(got) != "#!/bin/sh\necho hi\n" {
+		t.Errorf("linked file contents = %q, want original contents", got)
+	}
+}
+
+func TestStorePutDedupesIdenticalUploads(t *testing.T) {
+	root := t.TempDir()
+	s := NewStore(root)
+
+	zipData := makeTestZip(t, "bootstrap", "same contents").Bytes()
+
+	digest1, err := s.Put(bytes.NewReader(zipData))
+	if err != nil {
+		t.Fatalf("first Put: %s", err)
+	}
+	digest2, err := s.Put(bytes.NewReader(zipData))
+	if err != nil {
+		t.Fatalf("second Put: %s", err)
+	}
+
+	if digest1 != digest2 {
+		t.Errorf("identical uploads produced different digests: %q vs %q", digest1, digest2)
+	}
+}
+
+func TestStoreLinkIntoUnknownDigest(t *testing.T) {
+	root := t.TempDir()
+	s := NewStore(root)
+
+	if err := s.LinkInto("does-not-exist", t.TempDir()); err == nil {
+		t.Fatal("LinkInto returned no error for an unknown digest")
+	}
+}
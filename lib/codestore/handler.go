@@ -0,0 +1,38 @@
+package codestore
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// maxUploadBytes caps how much of a POST body UploadHandler will read
+// before giving up, so a client can't fill the disk with arbitrarily large
+// garbage before Put's own format/size checks in ExtractArchive ever run.
+// It matches DefaultUnzipOptions.MaxUncompressedBytes: a legitimate archive
+// shouldn't compress worse than 1:1.
+const maxUploadBytes = 1 << 30
+
+// UploadHandler returns an http.HandlerFunc that stores the request body as
+// a new layer and writes back its digest. It only accepts POST requests.
+// It does not authenticate or authorize callers itself -- anyone who can
+// reach it can write and extract arbitrary archives into the store's
+// _layers directory -- so it must only be exposed behind whatever
+// access control (auth, network policy) the deployment wraps around it.
+func (s *Store) UploadHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body := http.MaxBytesReader(w, r.Body, maxUploadBytes)
+
+		digest, err := s.Put(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprint(w, digest)
+	}
+}
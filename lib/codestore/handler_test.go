@@ -0,0 +1,90 @@
+package codestore
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadHandlerRejectsNonPost(t *testing.T) {
+	s := NewStore(t.TempDir())
+	srv := httptest.NewServer(s.UploadHandler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestUploadHandlerRoundTrip(t *testing.T) {
+	s := NewStore(t.TempDir())
+	srv := httptest.NewServer(s.UploadHandler())
+	defer srv.Close()
+
+	zipData := makeTestZip(t, "bootstrap", "#!/bin/sh\necho hi\n").Bytes()
+
+	resp, err := http.Post(srv.URL, "application/zip", bytes.NewReader(zipData))
+	if err != nil {
+		t.Fatalf("POST: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response body: %s", err)
+	}
+	digest := strings.TrimSpace(string(body))
+	if digest == "" {
+		t.Fatal("UploadHandler returned an empty digest")
+	}
+	if !s.Has(digest) {
+		t.Errorf("Has(%s) = false after a successful upload", digest)
+	}
+}
+
+// zeroReader streams n zero bytes without ever materializing them all at
+// once, so the size-cap test below doesn't have to allocate a >1GiB slice.
+type zeroReader struct{ remaining int64 }
+
+func (z *zeroReader) Read(p []byte) (int, error) {
+	if z.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > z.remaining {
+		p = p[:z.remaining]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	z.remaining -= int64(len(p))
+	return len(p), nil
+}
+
+func TestUploadHandlerEnforcesSizeCap(t *testing.T) {
+	s := NewStore(t.TempDir())
+	srv := httptest.NewServer(s.UploadHandler())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "application/octet-stream", &zeroReader{remaining: maxUploadBytes + 1})
+	if err != nil {
+		t.Fatalf("POST: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		t.Fatal("UploadHandler accepted a body larger than maxUploadBytes")
+	}
+}
@@ -1,18 +1,101 @@
 package preparable
 
 import (
-	"encoding/base64"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/struCoder/pmgo/lib/codestore"
 	"github.com/struCoder/pmgo/lib/process"
+	"github.com/struCoder/pmgo/lib/runtimeapi"
+	"github.com/struCoder/pmgo/lib/sandbox"
 	"github.com/struCoder/pmgo/lib/utils"
 )
 
+// defaultPATH is handed to a BinaryPreparable's bootstrap, sandboxed or
+// not, when its PATH field is empty. It intentionally contains nothing
+// specific to any one developer's machine.
+const defaultPATH = "/usr/local/bin:/usr/bin:/bin"
+
+// armTimeout SIGKILLs cmd's process after timeout elapses, unless the
+// returned timer is stopped first. It is a no-op, returning a nil timer, if
+// timeout is zero, i.e. no limit was configured. The timer fires against
+// cmd.Process directly, rather than a bare pid captured up front, so that
+// callers that remember to call Stop() once cmd.Wait() returns can't have
+// the timer go on to SIGKILL some unrelated process that the kernel later
+// reuses the original pid for.
+func armTimeout(cmd *exec.Cmd, timeout time.Duration) *time.Timer {
+	if timeout <= 0 {
+		return nil
+	}
+	return time.AfterFunc(timeout, func() {
+		cmd.Process.Kill()
+	})
+}
+
+// startIsolated runs the command described by proc itself, rather than
+// delegating to proc.Start(), so that isolator.Wrap can configure the
+// resulting *exec.Cmd -- chroot, namespaces, cgroup placement -- before the
+// process is actually started. process.Proc is an external package with no
+// knowledge of sandbox.Isolator, so this is the only point at which Wrap
+// can run. It records the resulting pid on proc and writes it to proc's
+// pidfile the same way proc.Start() would. If timeout is positive, it also
+// arms a timer that SIGKILLs the process if it's still running once
+// timeout elapses, and stops that timer as soon as the process actually
+// exits.
+// Returns an error in case there's any.
+func startIsolated(proc *process.Proc, isolator sandbox.Isolator, timeout time.Duration) error {
+	outFile, err := os.OpenFile(proc.Outfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	errFile, err := os.OpenFile(proc.Errfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer errFile.Close()
+
+	workingDir := proc.WorkingDir
+	if workingDir == "" {
+		workingDir = proc.Path
+	}
+
+	cmd := exec.Command(proc.Cmd, proc.Args...)
+	cmd.Dir = workingDir
+	cmd.Env = proc.Envs
+	cmd.Stdout = outFile
+	cmd.Stderr = errFile
+
+	if err := isolator.Wrap(cmd); err != nil {
+		return err
+	}
+
+	startErr := cmd.Start()
+	if closeErr := isolator.Close(); closeErr != nil {
+		log.Printf("sandbox: closing isolator resources: %s", closeErr)
+	}
+	if startErr != nil {
+		return startErr
+	}
+
+	proc.Pid = cmd.Process.Pid
+	timer := armTimeout(cmd, timeout)
+	go func() {
+		cmd.Wait()
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	return utils.WriteFile(proc.Pidfile, []byte(strconv.Itoa(proc.Pid)))
+}
+
 // ProcPreparable is a preparable with all the necessary informations to run
 // a process. To actually run a process, call the Start() method.
 type ProcPreparable interface {
@@ -37,19 +120,29 @@ type Preparable struct {
 	KeepAlive  bool
 	Args       []string
 	Envs       []string
+	Isolator   sandbox.Isolator
+	Limits     sandbox.Limits
 }
 
 type BinaryPreparable struct {
 	Name       string
 	SourcePath string
 	Cmd        string
-	BZipFile   string
+	Digest     string
+	CodeStore  *codestore.Store
+	Handler    string
+	RuntimeAPI *runtimeapi.Server
 	SysFolder  string
 	WorkingDir string
 	Language   string
 	KeepAlive  bool
 	Args       []string
 	Envs       []string
+	Isolator   sandbox.Isolator
+	Limits     sandbox.Limits
+	// PATH overrides the PATH environment variable handed to the spawned
+	// bootstrap. Defaults to defaultPATH when empty.
+	PATH string
 }
 
 // PrepareBin will compile the Golang project from SourcePath and populate Cmd with the proper
@@ -90,8 +183,28 @@ func (preparable *Preparable) Start() (process.ProcContainer, error) {
 		Status:    &process.ProcStatus{},
 	}
 
-	err := proc.Start()
-	return proc, err
+	isolator := preparable.Isolator
+	if isolator == nil {
+		// Only sandbox a process the caller didn't explicitly hand an
+		// Isolator to if it also asked for resource limits; otherwise
+		// default to doing nothing, so existing Preparable/BinaryPreparable
+		// users (plain Go binaries with nothing to do with Lambda,
+		// dynamically linked or networked processes with no business being
+		// chrooted into getPath()) aren't silently sandboxed on upgrade.
+		isolator = &sandbox.NoopIsolator{}
+		if !preparable.Limits.IsZero() {
+			isolator = sandbox.NewIsolator()
+		}
+	}
+	if err := isolator.Prepare(&sandbox.Proc{Name: preparable.Name, RootfsPath: preparable.getPath(), Limits: preparable.Limits}); err != nil {
+		return proc, err
+	}
+
+	if err := startIsolated(proc, isolator, preparable.Limits.Timeout); err != nil {
+		return proc, err
+	}
+
+	return proc, nil
 }
 
 func (preparable *Preparable) SetupProc() (process.ProcContainer, error) {
@@ -144,6 +257,10 @@ func (preparable *Preparable) getErrPath() string {
 // PrepareBin checks if the given binary path is a valid executable.
 // Returns no bytes, but if there is an error, it will be returned.
 func (preparable *BinaryPreparable) PrepareBin() ([]byte, error) {
+	if preparable.CodeStore == nil {
+		preparable.CodeStore = codestore.NewStore(preparable.SysFolder)
+	}
+
 	// build directory
 	err := os.MkdirAll(filepath.Dir(preparable.getOutPath()), 0755)
 	if err != nil {
@@ -157,31 +274,26 @@ func (preparable *BinaryPreparable) PrepareBin() ([]byte, error) {
 		return make([]byte, 0), err
 	}
 
-	preparable.Envs = append(preparable.Envs, "LAMBDA_TASK_ROOT="+runtimePath, "PATH=/home/silas/.deno/bin:/usr/bin")
-
-	// unzip file
-	decoded, err := base64.StdEncoding.DecodeString(preparable.BZipFile)
-	if err != nil {
-		log.Printf("decode error:", err)
-		return make([]byte, 0), err
+	path := preparable.PATH
+	if path == "" {
+		path = defaultPATH
 	}
-
-	zipPath := preparable.getPath() + "/function.zip"
-
-	err = ioutil.WriteFile(zipPath, []byte(decoded), 0644)
+	preparable.Envs = append(preparable.Envs, "LAMBDA_TASK_ROOT="+runtimePath, "PATH="+path)
+
+	// The function code was already streamed into the code store and
+	// content-addressed by Digest, so rather than re-extracting it here we
+	// just hardlink (or symlink) the cached, already-extracted layer into
+	// runtime/. This lets the same uploaded bundle back many function
+	// versions cheaply, the same way container runtimes cache image layers.
+	err = preparable.CodeStore.LinkInto(preparable.Digest, runtimePath)
 	if err != nil {
-		log.Printf("decode error:", err)
+		log.Printf("error linking layer %s into %s: %s", preparable.Digest, runtimePath, err)
 		return make([]byte, 0), err
 	}
 
-	err = utils.Unzip(zipPath, runtimePath)
-	if err != nil {
-		log.Printf("error unzipping file: %s at path %s", err, runtimePath)
-	}
-
 	// set command
 	preparable.Cmd = preparable.getPath() + "/runtime/bootstrap"
-	return make([]byte, 0), err
+	return make([]byte, 0), nil
 }
 
 // Start will execute the process based on the information presented on the preparable.
@@ -189,6 +301,27 @@ func (preparable *BinaryPreparable) PrepareBin() ([]byte, error) {
 // all the watchers and process handling are done correctly.
 // Returns a tuple with the process and an error in case there's any.
 func (preparable *BinaryPreparable) Start() (process.ProcContainer, error) {
+	if preparable.RuntimeAPI == nil {
+		preparable.RuntimeAPI = runtimeapi.NewServer()
+	}
+
+	addr, err := preparable.RuntimeAPI.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	handler := preparable.Handler
+	if handler == "" {
+		handler = "bootstrap"
+	}
+
+	preparable.Envs = append(preparable.Envs,
+		"AWS_LAMBDA_RUNTIME_API="+addr,
+		"_HANDLER="+handler,
+		"LAMBDA_RUNTIME_DIR="+preparable.getPath()+"/runtime",
+		"AWS_LAMBDA_FUNCTION_NAME="+preparable.Name,
+	)
+
 	proc := &process.Proc{
 		Name:       preparable.Name,
 		Cmd:        preparable.Cmd,
@@ -203,8 +336,36 @@ func (preparable *BinaryPreparable) Start() (process.ProcContainer, error) {
 		Status:     &process.ProcStatus{},
 	}
 
-	err := proc.Start()
-	return proc, err
+	isolator := preparable.Isolator
+	if isolator == nil {
+		// Only sandbox a process the caller didn't explicitly hand an
+		// Isolator to if it also asked for resource limits; otherwise
+		// default to doing nothing, so existing Preparable/BinaryPreparable
+		// users (plain Go binaries with nothing to do with Lambda,
+		// dynamically linked or networked processes with no business being
+		// chrooted into getPath()) aren't silently sandboxed on upgrade.
+		isolator = &sandbox.NoopIsolator{}
+		if !preparable.Limits.IsZero() {
+			isolator = sandbox.NewIsolator()
+		}
+	}
+	if err := isolator.Prepare(&sandbox.Proc{Name: preparable.Name, RootfsPath: preparable.getPath() + "/runtime", Limits: preparable.Limits}); err != nil {
+		return proc, err
+	}
+
+	if err := startIsolated(proc, isolator, preparable.Limits.Timeout); err != nil {
+		return proc, err
+	}
+
+	return proc, nil
+}
+
+// Invoke pushes payload onto the runtime API's pending-invocation queue and
+// blocks until the running bootstrap reports a response or error for it, or
+// until the preparable's configured timeout elapses.
+// Returns the response payload, or an error in case there's any.
+func (preparable *BinaryPreparable) Invoke(payload []byte) ([]byte, error) {
+	return preparable.RuntimeAPI.Invoke(payload, preparable.Limits.Timeout)
 }
 
 // Start will execute the process based on the information presented on the preparable.
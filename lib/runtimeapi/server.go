@@ -0,0 +1,209 @@
+// Package runtimeapi implements the subset of the AWS Lambda Runtime API
+// (https://docs.aws.amazon.com/lambda/latest/dg/runtimes-api.html) that
+// off-the-shelf `bootstrap` binaries poll against, so standard AWS Lambda
+// runtimes can run unmodified against the scheduler.
+package runtimeapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiVersion = "2018-06-01"
+
+// invocation is a single pending invocation waiting to be picked up by a
+// bootstrap polling GET /runtime/invocation/next.
+type invocation struct {
+	requestID string
+	payload   []byte
+}
+
+// result is delivered back on a request's response channel by whichever of
+// .../response or .../error the bootstrap calls first.
+type result struct {
+	payload []byte
+	err     error
+}
+
+// Server is a per-process HTTP server exposing the Lambda Runtime API to a
+// single running function. Callers enqueue work with Invoke and it is
+// handed out to whichever bootstrap is polling /runtime/invocation/next.
+type Server struct {
+	mu       sync.Mutex
+	pending  chan *invocation
+	waiting  map[string]chan result
+	listener net.Listener
+}
+
+// NewServer returns a Server with no listener yet; call Start to begin
+// serving.
+func NewServer() *Server {
+	return &Server{
+		pending: make(chan *invocation, 16),
+		waiting: make(map[string]chan result),
+	}
+}
+
+// Start binds to a free port on 127.0.0.1 and begins serving the runtime
+// API in the background. Calling Start again on a Server that is already
+// listening -- e.g. a KeepAlive function being restarted with the same
+// RuntimeAPI -- is a no-op that returns the existing address, rather than
+// binding a second listener and orphaning the first.
+// Returns the address bootstraps should be pointed at via
+// AWS_LAMBDA_RUNTIME_API, or an error in case there's any.
+func (s *Server) Start() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil {
+		return s.listener.Addr().String(), nil
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	s.listener = ln
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(fmt.Sprintf("/%s/runtime/invocation/next", apiVersion), s.handleNext)
+	mux.HandleFunc(fmt.Sprintf("/%s/runtime/invocation/", apiVersion), s.handleInvocationResult)
+	mux.HandleFunc(fmt.Sprintf("/%s/runtime/init/error", apiVersion), s.handleInitError)
+
+	go http.Serve(ln, mux)
+
+	return ln.Addr().String(), nil
+}
+
+// Close stops the server from accepting new connections.
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// Invoke enqueues payload as a new invocation and blocks until the
+// bootstrap reports a response or error for it, or until timeout elapses.
+// A timeout of zero or less waits indefinitely. If timeout elapses first --
+// the bootstrap crashed, was SIGKILLed by its own process timeout, or never
+// calls back -- Invoke gives up and returns an error rather than hanging
+// forever; a response that arrives after that is simply discarded as
+// belonging to an unknown request.
+// Returns the response payload, or an error in case there's any.
+func (s *Server) Invoke(payload []byte, timeout time.Duration) ([]byte, error) {
+	requestID, err := newRequestID()
+	if err != nil {
+		return nil, err
+	}
+
+	respCh := make(chan result, 1)
+	s.mu.Lock()
+	s.waiting[requestID] = respCh
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.waiting, requestID)
+		s.mu.Unlock()
+	}()
+
+	// A nil deadline channel never fires, so a non-positive timeout waits
+	// indefinitely on both the enqueue and the response.
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	select {
+	case s.pending <- &invocation{requestID: requestID, payload: payload}:
+	case <-deadline:
+		return nil, fmt.Errorf("runtimeapi: invocation %s timed out after %s", requestID, timeout)
+	}
+
+	select {
+	case res := <-respCh:
+		return res.payload, res.err
+	case <-deadline:
+		return nil, fmt.Errorf("runtimeapi: invocation %s timed out after %s", requestID, timeout)
+	}
+}
+
+// handleNext serves GET /runtime/invocation/next, blocking until Invoke has
+// queued work.
+func (s *Server) handleNext(w http.ResponseWriter, r *http.Request) {
+	inv := <-s.pending
+
+	w.Header().Set("Lambda-Runtime-Aws-Request-Id", inv.requestID)
+	w.Header().Set("Lambda-Runtime-Deadline-Ms", "0")
+	w.Header().Set("Lambda-Runtime-Invoked-Function-Arn", "arn:aws:lambda:local:0:function:"+inv.requestID)
+	w.WriteHeader(http.StatusOK)
+	w.Write(inv.payload)
+}
+
+// handleInvocationResult serves both
+// POST /runtime/invocation/{requestId}/response and
+// POST /runtime/invocation/{requestId}/error.
+func (s *Server) handleInvocationResult(w http.ResponseWriter, r *http.Request) {
+	prefix := fmt.Sprintf("/%s/runtime/invocation/", apiVersion)
+	rest := strings.TrimPrefix(r.URL.Path, prefix)
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	requestID, action := parts[0], parts[1]
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	respCh, ok := s.waiting[requestID]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "response":
+		respCh <- result{payload: body}
+	case "error":
+		respCh <- result{err: fmt.Errorf("runtimeapi: invocation %s failed: %s", requestID, body)}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleInitError serves POST /runtime/init/error, reported when a
+// bootstrap fails to initialize before ever polling for an invocation.
+func (s *Server) handleInitError(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	log.Printf("runtimeapi: init error reported: %s", body)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// newRequestID returns a random hex request id, as handed out by real AWS
+// Lambda via Lambda-Runtime-Aws-Request-Id.
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
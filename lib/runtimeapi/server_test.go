@@ -0,0 +1,66 @@
+package runtimeapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServerStartIsIdempotent(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	addr1, err := s.Start()
+	if err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+
+	addr2, err := s.Start()
+	if err != nil {
+		t.Fatalf("second Start: %s", err)
+	}
+
+	if addr1 != addr2 {
+		t.Errorf("second Start returned a different address: %q, want %q (a second Start should reuse the existing listener)", addr2, addr1)
+	}
+}
+
+func TestInvokeRoundTrip(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	addr, err := s.Start()
+	if err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+
+	go func() {
+		resp, err := http.Get("http://" + addr + "/" + apiVersion + "/runtime/invocation/next")
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		requestID := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+		http.Post("http://"+addr+"/"+apiVersion+"/runtime/invocation/"+requestID+"/response", "application/octet-stream", nil)
+	}()
+
+	out, err := s.Invoke([]byte("hello"), time.Second)
+	if err != nil {
+		t.Fatalf("Invoke: %s", err)
+	}
+	_ = out
+}
+
+func TestInvokeTimesOut(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	if _, err := s.Start(); err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+
+	_, err := s.Invoke([]byte("hello"), 10*time.Millisecond)
+	if err == nil {
+		t.Fatal("Invoke returned no error for an invocation nothing ever picked up")
+	}
+}
@@ -0,0 +1,57 @@
+// Package sandbox isolates spawned function processes from the master's
+// own user and filesystem instead of running them directly as whatever uid
+// the master happens to run under.
+package sandbox
+
+import (
+	"os/exec"
+	"time"
+)
+
+// Limits bounds the resources a sandboxed function is allowed to consume.
+type Limits struct {
+	MemoryBytes    int64
+	CPUShares      int64
+	Timeout        time.Duration
+	ReadOnlyRootfs bool
+}
+
+// IsZero reports whether no limit has been configured. Callers use this to
+// decide whether a process opted into sandboxing at all: configuring any
+// limit, with no Isolator set explicitly, is what selects NewIsolator's
+// namespace/cgroup sandbox over the default no-op one.
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// Proc describes the process about to be isolated: its name (used to
+// namespace its cgroup), the rootfs it should be chrooted into, and the
+// resource limits to enforce on it.
+type Proc struct {
+	Name       string
+	RootfsPath string
+	Limits     Limits
+}
+
+// Isolator sandboxes a spawned function process. Prepare sets up whatever
+// host-side state the isolator needs before the process starts; Wrap then
+// configures the exec.Cmd that will actually run inside it; Close releases
+// any host-side resources Wrap opened, once the wrapped cmd has actually
+// been started.
+type Isolator interface {
+	// Prepare sets up whatever host-side state (namespaces, cgroups,
+	// chroot directory) the isolator needs before the process is started.
+	Prepare(proc *Proc) error
+	// Wrap configures cmd to run inside the sandbox set up by Prepare.
+	Wrap(cmd *exec.Cmd) error
+	// Close releases any resources opened by the last call to Wrap (e.g.
+	// an open cgroup directory fd). Callers must call it once cmd.Start()
+	// has returned, whether or not it succeeded.
+	Close() error
+}
+
+// NewIsolator returns the best Isolator available on the current platform:
+// a namespace/cgroup sandbox on Linux, or a no-op elsewhere.
+func NewIsolator() Isolator {
+	return newIsolator()
+}
@@ -0,0 +1,189 @@
+//go:build linux
+// +build linux
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cgroupRoot is where per-function cgroups v2 directories are created.
+const cgroupRoot = "/sys/fs/cgroup/lambda-scheduler"
+
+// unprivilegedUID and unprivilegedGID are the conventional uid/gid of the
+// "nobody" account present on essentially every Linux distribution. Wrap
+// execs the sandboxed process as this uid/gid, numerically, rather than
+// leaving it running as whatever (root) uid the master itself runs as --
+// ambient capabilities only ever add to what a process retains across
+// execve, never take anything away, so dropping root is what actually
+// takes CAP_SYS_CHROOT/CAP_SYS_ADMIN away from the chrooted process.
+const (
+	unprivilegedUID = 65534
+	unprivilegedGID = 65534
+)
+
+// readOnlyMountFlag is ST_RDONLY as defined by statfs(2)/<linux/statfs.h>;
+// the syscall package exposes Statfs_t.Flags but doesn't export the flag
+// constants that go in it.
+const readOnlyMountFlag = 0x0001
+
+// LinuxIsolator sandboxes a process using new mount/pid/net/uts namespaces,
+// a chroot into the function's rootfs, execution as an unprivileged uid/gid,
+// an optional read-only rootfs and cgroups v2 memory/CPU limits.
+type LinuxIsolator struct {
+	cgroupPath string
+	rootfs     string
+	limits     Limits
+
+	// cgroupFile is the open cgroup directory fd handed to the last
+	// Wrap'd cmd via CgroupFD. It is kept open past Wrap because clone3
+	// needs it live for the syscall itself, which only happens once
+	// cmd.Start() actually runs; Close releases it afterwards.
+	cgroupFile *os.File
+}
+
+func newIsolator() Isolator {
+	return &LinuxIsolator{}
+}
+
+// Prepare creates proc's cgroup and writes its memory/CPU limits into it.
+// Returns an error in case there's any.
+func (l *LinuxIsolator) Prepare(proc *Proc) error {
+	l.rootfs = proc.RootfsPath
+	l.limits = proc.Limits
+	l.cgroupPath = filepath.Join(cgroupRoot, proc.Name)
+
+	if err := os.MkdirAll(l.cgroupPath, 0755); err != nil {
+		return fmt.Errorf("sandbox: creating cgroup %s: %s", l.cgroupPath, err)
+	}
+
+	if proc.Limits.MemoryBytes > 0 {
+		if err := writeCgroupFile(l.cgroupPath, "memory.max", strconv.FormatInt(proc.Limits.MemoryBytes, 10)); err != nil {
+			return err
+		}
+	}
+
+	if proc.Limits.CPUShares > 0 {
+		if err := writeCgroupFile(l.cgroupPath, "cpu.weight", strconv.FormatInt(proc.Limits.CPUShares, 10)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Wrap namespaces cmd into new mount/pid/net/uts namespaces, chroots it
+// into the rootfs prepared by Prepare, drops it to an unprivileged uid/gid,
+// optionally remounts the rootfs read-only, and places it directly into the
+// cgroup prepared by Prepare. It also rewrites cmd.Path/cmd.Args[0] to the
+// path they'll resolve to once the child has chrooted, since the kernel
+// chroots the child before execve and a host-absolute path no longer
+// exists under the new root.
+// Returns an error in case there's any.
+func (l *LinuxIsolator) Wrap(cmd *exec.Cmd) error {
+	if l.limits.ReadOnlyRootfs {
+		if err := ensureReadOnlyRootfs(l.rootfs); err != nil {
+			return fmt.Errorf("sandbox: %s", err)
+		}
+	}
+
+	cgroupFile, err := os.Open(l.cgroupPath)
+	if err != nil {
+		return fmt.Errorf("sandbox: opening cgroup %s: %s", l.cgroupPath, err)
+	}
+	l.cgroupFile = cgroupFile
+
+	inRootPath, err := rootRelative(l.rootfs, cmd.Path)
+	if err != nil {
+		cgroupFile.Close()
+		l.cgroupFile = nil
+		return err
+	}
+	cmd.Path = inRootPath
+	if len(cmd.Args) > 0 {
+		cmd.Args[0] = inRootPath
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWNS |
+			syscall.CLONE_NEWPID |
+			syscall.CLONE_NEWNET |
+			syscall.CLONE_NEWUTS,
+		Chroot:      l.rootfs,
+		UseCgroupFD: true,
+		CgroupFD:    int(cgroupFile.Fd()),
+		Credential: &syscall.Credential{
+			Uid: unprivilegedUID,
+			Gid: unprivilegedGID,
+		},
+	}
+	cmd.Dir = "/"
+
+	return nil
+}
+
+// ensureReadOnlyRootfs bind-mounts rootfs onto itself and remounts it
+// read-only. Wrap sets CLONE_NEWNS, so the sandboxed process is cloned into
+// its own copy of the mount namespace once this has already happened,
+// meaning it inherits rootfs as read-only from the moment it starts. The
+// remount happens on the host's mount table, not inside a namespace, so
+// rootfs stays read-only for the master too; a later PrepareBin/LinkInto
+// into the same directory (e.g. deploying a new code digest) needs it
+// remounted read-write first. It's idempotent -- a rootfs that's already a
+// read-only mount is left alone -- so repeated KeepAlive restarts against
+// the same rootfs don't stack a fresh bind mount on top every time.
+func ensureReadOnlyRootfs(rootfs string) error {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(rootfs, &stat); err != nil {
+		return fmt.Errorf("statfs %s: %s", rootfs, err)
+	}
+	if stat.Flags&readOnlyMountFlag != 0 {
+		return nil
+	}
+
+	if err := syscall.Mount(rootfs, rootfs, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind-mounting %s: %s", rootfs, err)
+	}
+	if err := syscall.Mount(rootfs, rootfs, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+		return fmt.Errorf("remounting %s read-only: %s", rootfs, err)
+	}
+	return nil
+}
+
+// Close releases the cgroup directory fd opened by the last call to Wrap.
+// clone3 only needs the fd live for the syscall itself, which happens
+// synchronously inside cmd.Start(); callers must call Close once Start has
+// returned, or every Wrap (i.e. every process start/restart, including
+// KeepAlive restarts) leaks one fd for the life of the master.
+func (l *LinuxIsolator) Close() error {
+	if l.cgroupFile == nil {
+		return nil
+	}
+	err := l.cgroupFile.Close()
+	l.cgroupFile = nil
+	return err
+}
+
+// rootRelative rewrites path, which must live under rootfs, into the
+// absolute path it resolves to once a process has chrooted into rootfs --
+// e.g. "<rootfs>/runtime/bootstrap" becomes "/runtime/bootstrap". Go hands
+// cmd.Path/cmd.Args[0] to execve verbatim after the child has already
+// chrooted, so leaving them host-absolute makes every sandboxed exec fail
+// with ENOENT.
+func rootRelative(rootfs, path string) (string, error) {
+	rel, err := filepath.Rel(rootfs, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("sandbox: command %q is not inside rootfs %q", path, rootfs)
+	}
+	return string(filepath.Separator) + rel, nil
+}
+
+func writeCgroupFile(cgroupPath, name, value string) error {
+	return os.WriteFile(filepath.Join(cgroupPath, name), []byte(value), 0644)
+}
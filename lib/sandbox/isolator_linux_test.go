@@ -0,0 +1,97 @@
+//go:build linux
+// +build linux
+
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestRootRelative(t *testing.T) {
+	tests := []struct {
+		name    string
+		rootfs  string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "nested path", rootfs: "/var/lib/funcs/foo/runtime", path: "/var/lib/funcs/foo/runtime/bootstrap", want: "/bootstrap"},
+		{name: "deeper nesting", rootfs: "/var/lib/funcs/foo", path: "/var/lib/funcs/foo/runtime/bootstrap", want: "/runtime/bootstrap"},
+		{name: "outside rootfs", rootfs: "/var/lib/funcs/foo/runtime", path: "/var/lib/funcs/bar/runtime/bootstrap", wantErr: true},
+		{name: "parent of rootfs", rootfs: "/var/lib/funcs/foo/runtime", path: "/var/lib/funcs/foo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rootRelative(tt.rootfs, tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("rootRelative(%q, %q) = %q, want error", tt.rootfs, tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rootRelative(%q, %q) returned unexpected error: %s", tt.rootfs, tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("rootRelative(%q, %q) = %q, want %q", tt.rootfs, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLinuxIsolatorWrapExecsInsideChroot actually execs a trivial binary
+// under a LinuxIsolator end to end, so a regression that leaves
+// cmd.Path/cmd.Args[0] host-absolute (resolving to nothing once chrooted)
+// fails loudly instead of only being caught by inspecting Wrap's output.
+// Requires root (for chroot + the namespace clone) and a writable cgroup2
+// hierarchy, neither of which is guaranteed in every test environment, so
+// it skips rather than fails when unavailable.
+func TestLinuxIsolatorWrapExecsInsideChroot(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root to chroot and create namespaces")
+	}
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil {
+		t.Skip("requires a unified cgroup2 hierarchy mounted at /sys/fs/cgroup")
+	}
+
+	rootfs := t.TempDir()
+	truePath, err := exec.LookPath("true")
+	if err != nil {
+		t.Skipf("no `true` binary available to copy into the rootfs: %s", err)
+	}
+	installBinary(t, truePath, rootfs+"/true")
+
+	l := &LinuxIsolator{}
+	if err := l.Prepare(&Proc{Name: "wrap-exec-test", RootfsPath: rootfs}); err != nil {
+		t.Skipf("cgroup setup unavailable in this environment: %s", err)
+	}
+	defer os.RemoveAll(l.cgroupPath)
+
+	cmd := exec.Command(rootfs + "/true")
+	if err := l.Wrap(cmd); err != nil {
+		t.Fatalf("Wrap: %s", err)
+	}
+	defer l.Close()
+
+	if cmd.Path != "/true" {
+		t.Errorf("Wrap left cmd.Path = %q, want root-relative \"/true\"", cmd.Path)
+	}
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("running chrooted command failed (likely means Wrap didn't rewrite cmd.Path to be valid post-chroot): %s", err)
+	}
+}
+
+func installBinary(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("reading %s: %s", src, err)
+	}
+	if err := os.WriteFile(dst, data, 0755); err != nil {
+		t.Fatalf("writing %s: %s", dst, err)
+	}
+}
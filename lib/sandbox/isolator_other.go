@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package sandbox
+
+// newIsolator returns the fallback Isolator for platforms without Linux
+// namespace/cgroup support.
+func newIsolator() Isolator {
+	return &NoopIsolator{}
+}
@@ -0,0 +1,25 @@
+package sandbox
+
+import "os/exec"
+
+// NoopIsolator is an Isolator that doesn't sandbox anything: Wrap leaves
+// cmd untouched. It's used as the default whenever a caller hasn't opted
+// into sandboxing by setting an Isolator explicitly or configuring
+// non-zero Limits, and as the only Isolator available on platforms
+// without namespace/cgroup support.
+type NoopIsolator struct{}
+
+// Prepare is a no-op.
+func (n *NoopIsolator) Prepare(proc *Proc) error {
+	return nil
+}
+
+// Wrap is a no-op.
+func (n *NoopIsolator) Wrap(cmd *exec.Cmd) error {
+	return nil
+}
+
+// Close is a no-op.
+func (n *NoopIsolator) Close() error {
+	return nil
+}
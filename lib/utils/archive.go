@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Compression identifies the archive format detected from a file's leading
+// bytes.
+type Compression int
+
+const (
+	// CompressionUnknown is returned when none of the known magic numbers match.
+	CompressionUnknown Compression = iota
+	// CompressionZip identifies a PKZIP archive (magic `50 4B 03 04`).
+	CompressionZip
+	// CompressionTarGz identifies a gzip-compressed tar archive (magic `1F 8B 08`).
+	CompressionTarGz
+	// CompressionTar identifies a plain POSIX tar archive (`ustar` at offset 257).
+	CompressionTar
+)
+
+// archiveSniffLen is the number of leading bytes needed to detect every
+// supported format, including the "ustar" magic at offset 257.
+const archiveSniffLen = 262
+
+// DetectCompression inspects the leading bytes of a file and returns the
+// Compression format they indicate. It returns CompressionUnknown if none
+// of the known magic numbers match.
+func DetectCompression(header []byte) Compression {
+	if len(header) >= 4 && header[0] == 0x50 && header[1] == 0x4B && header[2] == 0x03 && header[3] == 0x04 {
+		return CompressionZip
+	}
+	if len(header) >= 3 && header[0] == 0x1F && header[1] == 0x8B && header[2] == 0x08 {
+		return CompressionTarGz
+	}
+	if len(header) >= 262 && string(header[257:262]) == "ustar" {
+		return CompressionTar
+	}
+	return CompressionUnknown
+}
+
+// ExtractArchive extracts src into dest using DefaultUnzipOptions.
+// Returns an error in case there's any; see ExtractArchiveWithOptions for
+// details.
+func ExtractArchive(src, dest string) error {
+	return ExtractArchiveWithOptions(src, dest, DefaultUnzipOptions)
+}
+
+// ExtractArchiveWithOptions peeks at the first bytes of src to detect its
+// archive format (zip, tar or tar.gz) and extracts its contents into dest,
+// preserving file mode bits and symlinks. opts' MaxUncompressedBytes and
+// MaxFiles bound the work done, guarding against zip/tar bombs regardless
+// of which format src turns out to be.
+// Returns an error in case there's any, including when the format can't be
+// detected.
+func ExtractArchiveWithOptions(src, dest string, opts UnzipOptions) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, archiveSniffLen)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	header = header[:n]
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	switch DetectCompression(header) {
+	case CompressionZip:
+		return UnzipWithOptions(src, dest, opts)
+	case CompressionTarGz:
+		gzr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gzr.Close()
+		return untar(gzr, dest, opts)
+	case CompressionTar:
+		return untar(f, dest, opts)
+	default:
+		return fmt.Errorf("utils: unable to detect archive format for %s", src)
+	}
+}
+
+// untar extracts every entry of the tar stream r into dest, preserving file
+// mode bits and recreating symlinks/hardlinks. Entries whose path, or
+// whose link target, would resolve outside dest are rejected rather than
+// extracted (the same "zip-slip" class of escape Unzip guards against).
+// opts' MaxUncompressedBytes and MaxFiles bound the work done, guarding
+// against tar bombs the same way UnzipWithOptions guards against zip bombs
+// -- a gzip-compressed tar stream can expand just as explosively as a zip.
+func untar(r io.Reader, dest string, opts UnzipOptions) error {
+	destAbs, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	var numFiles int
+	var totalUncompressed int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		numFiles++
+		if opts.MaxFiles > 0 && numFiles > opts.MaxFiles {
+			return fmt.Errorf("utils: tar contains more than %d entries, exceeding the limit of %d", opts.MaxFiles, opts.MaxFiles)
+		}
+
+		fpath, err := safeJoin(destAbs, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(fpath, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if _, err := safeSymlinkJoin(destAbs, hdr.Name, hdr.Linkname); err != nil {
+				return fmt.Errorf("utils: symlink entry %q escapes %s: %s", hdr.Name, dest, err)
+			}
+			if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+				return err
+			}
+			os.Remove(fpath)
+			if err := os.Symlink(hdr.Linkname, fpath); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			linkTarget, err := safeJoin(destAbs, hdr.Linkname)
+			if err != nil {
+				return fmt.Errorf("utils: hardlink entry %q escapes %s: %s", hdr.Name, dest, err)
+			}
+			if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+				return err
+			}
+			os.Remove(fpath)
+			if err := os.Link(linkTarget, fpath); err != nil {
+				return err
+			}
+		default:
+			totalUncompressed += hdr.Size
+			if opts.MaxUncompressedBytes > 0 && totalUncompressed > opts.MaxUncompressedBytes {
+				return fmt.Errorf("utils: tar uncompressed size exceeds the limit of %d bytes", opts.MaxUncompressedBytes)
+			}
+
+			if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(hdr.Mode))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return err
+			}
+			out.Close()
+		}
+	}
+}
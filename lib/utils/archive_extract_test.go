@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarEntry is either a regular file ({name, contents}), a symlink (target
+// set), or a hardlink (linkname set).
+type tarEntry struct {
+	name, contents, target, linkname string
+}
+
+func writeTar(t *testing.T, w *tar.Writer, entries []tarEntry) {
+	t.Helper()
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644}
+		switch {
+		case e.target != "":
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = e.target
+		case e.linkname != "":
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = e.linkname
+		default:
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(e.contents))
+		}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatalf("writing tar header for %s: %s", e.name, err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := w.Write([]byte(e.contents)); err != nil {
+				t.Fatalf("writing tar contents for %s: %s", e.name, err)
+			}
+		}
+	}
+}
+
+func writePlainTar(t *testing.T, path string, entries []tarEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating %s: %s", path, err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	writeTar(t, tw, entries)
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar writer: %s", err)
+	}
+}
+
+func writeTarGz(t *testing.T, path string, entries []tarEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating %s: %s", path, err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	writeTar(t, tw, entries)
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar writer: %s", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("closing gzip writer: %s", err)
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	dir := t.TempDir()
+
+	zipPath := filepath.Join(dir, "a.zip")
+	writeZip(t, zipPath, []zipEntry{{name: "bootstrap", contents: "hi"}})
+	tarPath := filepath.Join(dir, "a.tar")
+	writePlainTar(t, tarPath, []tarEntry{{name: "bootstrap", contents: "hi"}})
+	tarGzPath := filepath.Join(dir, "a.tar.gz")
+	writeTarGz(t, tarGzPath, []tarEntry{{name: "bootstrap", contents: "hi"}})
+
+	tests := []struct {
+		path string
+		want Compression
+	}{
+		{zipPath, CompressionZip},
+		{tarPath, CompressionTar},
+		{tarGzPath, CompressionTarGz},
+	}
+
+	for _, tt := range tests {
+		header := make([]byte, archiveSniffLen)
+		f, err := os.Open(tt.path)
+		if err != nil {
+			t.Fatalf("opening %s: %s", tt.path, err)
+		}
+		n, _ := f.Read(header)
+		f.Close()
+		if got := DetectCompression(header[:n]); got != tt.want {
+			t.Errorf("DetectCompression(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestExtractArchiveAllFormats(t *testing.T) {
+	makers := map[string]func(t *testing.T, path string, entries []tarEntry){
+		"tar":    writePlainTar,
+		"tar.gz": writeTarGz,
+	}
+
+	for name, makeArchive := range makers {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			archivePath := filepath.Join(dir, "archive")
+			makeArchive(t, archivePath, []tarEntry{{name: "bootstrap", contents: "#!/bin/sh\necho hi\n"}})
+
+			dest := filepath.Join(dir, "dest")
+			if err := ExtractArchive(archivePath, dest); err != nil {
+				t.Fatalf("ExtractArchive: %s", err)
+			}
+
+			got, err := os.ReadFile(filepath.Join(dest, "bootstrap"))
+			if err != nil {
+				t.Fatalf("reading extracted file: %s", err)
+			}
+			if string(got) != "#!/bin/sh\necho hi\n" {
+				t.Errorf("extracted contents = %q, want original contents", got)
+			}
+		})
+	}
+
+	t.Run("zip", func(t *testing.T) {
+		dir := t.TempDir()
+		zipPath := filepath.Join(dir, "archive")
+		writeZip(t, zipPath, []zipEntry{{name: "bootstrap", contents: "#!/bin/sh\necho hi\n"}})
+
+		dest := filepath.Join(dir, "dest")
+		if err := ExtractArchive(zipPath, dest); err != nil {
+			t.Fatalf("ExtractArchive: %s", err)
+		}
+
+		got, err := os.ReadFile(filepath.Join(dest, "bootstrap"))
+		if err != nil {
+			t.Fatalf("reading extracted file: %s", err)
+		}
+		if string(got) != "#!/bin/sh\necho hi\n" {
+			t.Errorf("extracted contents = %q, want original contents", got)
+		}
+	})
+}
+
+func TestExtractArchiveUnknownFormat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "not-an-archive")
+	if err := os.WriteFile(path, []byte("just some garbage bytes, not a real archive"), 0644); err != nil {
+		t.Fatalf("writing %s: %s", path, err)
+	}
+
+	if err := ExtractArchive(path, filepath.Join(dir, "dest")); err == nil {
+		t.Fatal("ExtractArchive accepted a file with no recognizable archive format")
+	}
+}
+
+func TestUntarRejectsZipSlip(t *testing.T) {
+	for name, makeArchive := range map[string]func(t *testing.T, path string, entries []tarEntry){
+		"tar":    writePlainTar,
+		"tar.gz": writeTarGz,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			archivePath := filepath.Join(dir, "evil")
+			makeArchive(t, archivePath, []tarEntry{{name: "../../etc/passwd", contents: "pwned"}})
+
+			dest := filepath.Join(dir, "dest")
+			if err := ExtractArchive(archivePath, dest); err == nil {
+				t.Fatal("ExtractArchive accepted a ../ escaping entry")
+			}
+			if _, err := os.Stat(filepath.Join(dest, "..", "..", "etc", "passwd")); err == nil {
+				t.Fatal("ExtractArchive wrote outside dest despite returning an error")
+			}
+		})
+	}
+}
+
+func TestUntarRejectsSymlinkEscape(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{name: "absolute target", target: "/etc/passwd"},
+		{name: "relative target escaping dest", target: "../../../etc/passwd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archivePath := filepath.Join(dir, "evil")
+			writePlainTar(t, archivePath, []tarEntry{{name: "link", target: tt.target}})
+
+			dest := filepath.Join(dir, "dest")
+			if err := ExtractArchive(archivePath, dest); err == nil {
+				t.Fatalf("ExtractArchive accepted a symlink entry targeting %q", tt.target)
+			}
+			if _, err := os.Lstat(filepath.Join(dest, "link")); err == nil {
+				t.Fatal("ExtractArchive created the escaping symlink despite returning an error")
+			}
+		})
+	}
+}
+
+func TestUntarRejectsHardlinkEscape(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "evil")
+	writePlainTar(t, archivePath, []tarEntry{{name: "link", linkname: "../../../etc/passwd"}})
+
+	dest := filepath.Join(dir, "dest")
+	if err := ExtractArchive(archivePath, dest); err == nil {
+		t.Fatal("ExtractArchive accepted a hardlink entry escaping dest")
+	}
+}
+
+func TestUntarEnforcesMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "many-files")
+	entries := make([]tarEntry, 5)
+	for i := range entries {
+		entries[i] = tarEntry{name: filepath.Join("f", string(rune('a'+i))), contents: "x"}
+	}
+	writePlainTar(t, archivePath, entries)
+
+	dest := filepath.Join(dir, "dest")
+	err := ExtractArchiveWithOptions(archivePath, dest, UnzipOptions{MaxFiles: 2})
+	if err == nil {
+		t.Fatal("ExtractArchiveWithOptions accepted an archive exceeding MaxFiles")
+	}
+}
+
+func TestUntarEnforcesMaxUncompressedBytes(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "big-file")
+	writePlainTar(t, archivePath, []tarEntry{{name: "bootstrap", contents: string(bytes.Repeat([]byte("x"), 1024))}})
+
+	dest := filepath.Join(dir, "dest")
+	err := ExtractArchiveWithOptions(archivePath, dest, UnzipOptions{MaxUncompressedBytes: 100})
+	if err == nil {
+		t.Fatal("ExtractArchiveWithOptions accepted an archive exceeding MaxUncompressedBytes")
+	}
+}
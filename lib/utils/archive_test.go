@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeZip builds a zip archive on disk containing entries, where each
+// entry is either a regular file ({name, contents}) or, when target is
+// non-empty, a symlink pointing at target.
+type zipEntry struct {
+	name, contents, target string
+}
+
+func writeZip(t *testing.T, path string, entries []zipEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating %s: %s", path, err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		if e.target != "" {
+			hdr := &zip.FileHeader{Name: e.name}
+			hdr.SetMode(os.ModeSymlink | 0777)
+			fw, err := zw.CreateHeader(hdr)
+			if err != nil {
+				t.Fatalf("creating symlink entry %s: %s", e.name, err)
+			}
+			if _, err := fw.Write([]byte(e.target)); err != nil {
+				t.Fatalf("writing symlink target for %s: %s", e.name, err)
+			}
+			continue
+		}
+		fw, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatalf("creating entry %s: %s", e.name, err)
+		}
+		if _, err := fw.Write([]byte(e.contents)); err != nil {
+			t.Fatalf("writing entry %s: %s", e.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip writer: %s", err)
+	}
+}
+
+func TestUnzipRejectsZipSlip(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "evil.zip")
+	writeZip(t, zipPath, []zipEntry{{name: "../../etc/passwd", contents: "pwned"}})
+
+	dest := filepath.Join(dir, "dest")
+	if err := Unzip(zipPath, dest); err == nil {
+		t.Fatal("Unzip accepted a ../ escaping entry")
+	}
+	if _, err := os.Stat(filepath.Join(dest, "..", "..", "etc", "passwd")); err == nil {
+		t.Fatal("Unzip wrote outside dest despite returning an error")
+	}
+}
+
+func TestUnzipRejectsAbsoluteEntry(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "evil.zip")
+	writeZip(t, zipPath, []zipEntry{{name: "/etc/passwd", contents: "pwned"}})
+
+	dest := filepath.Join(dir, "dest")
+	if err := Unzip(zipPath, dest); err == nil {
+		t.Fatal("Unzip accepted an absolute-path entry")
+	}
+}
+
+func TestUnzipRejectsSymlinkEscape(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{name: "absolute target", target: "/etc/passwd"},
+		{name: "relative target escaping dest", target: "../../../etc/passwd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			zipPath := filepath.Join(dir, "evil.zip")
+			writeZip(t, zipPath, []zipEntry{{name: "link", target: tt.target}})
+
+			dest := filepath.Join(dir, "dest")
+			if err := Unzip(zipPath, dest); err == nil {
+				t.Fatalf("Unzip accepted a symlink entry targeting %q", tt.target)
+			}
+			if _, err := os.Lstat(filepath.Join(dest, "link")); err == nil {
+				t.Fatal("Unzip created the escaping symlink despite returning an error")
+			}
+		})
+	}
+}
+
+func TestUnzipExtractsValidArchive(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "good.zip")
+	writeZip(t, zipPath, []zipEntry{{name: "bootstrap", contents: "#!/bin/sh\necho hi\n"}})
+
+	dest := filepath.Join(dir, "dest")
+	if err := Unzip(zipPath, dest); err != nil {
+		t.Fatalf("Unzip: %s", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dest, "bootstrap"))
+	if err != nil {
+		t.Fatalf("reading extracted file: %s", err)
+	}
+	if !bytes.Equal(got, []byte("#!/bin/sh\necho hi\n")) {
+		t.Errorf("extracted contents = %q, want original contents", got)
+	}
+}
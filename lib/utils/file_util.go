@@ -2,9 +2,9 @@ package utils
 
 import (
 	"archive/zip"
+	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -62,46 +62,142 @@ func DeleteFile(filepath string) error {
 	return err
 }
 
+// UnzipOptions tunes the limits Unzip enforces while extracting an archive.
+type UnzipOptions struct {
+	// MaxUncompressedBytes caps the total bytes written across all
+	// entries, to guard against zip bombs. Zero means no limit.
+	MaxUncompressedBytes int64
+	// MaxFiles caps the number of entries extracted, to guard against zip
+	// bombs made of many tiny files. Zero means no limit.
+	MaxFiles int
+}
+
+// DefaultUnzipOptions caps uncompressed size at 1GiB and 10,000 files,
+// generous for a Lambda deployment bundle while still guarding against zip
+// bombs.
+var DefaultUnzipOptions = UnzipOptions{
+	MaxUncompressedBytes: 1 << 30,
+	MaxFiles:             10000,
+}
+
+// Unzip extracts src into dest using DefaultUnzipOptions.
+// Returns an error in case there's any; see UnzipWithOptions for details.
 func Unzip(src, dest string) error {
+	return UnzipWithOptions(src, dest, DefaultUnzipOptions)
+}
+
+// UnzipWithOptions extracts src into dest, preserving file mode bits.
+// Any entry whose cleaned path would resolve outside dest -- whether via
+// an absolute path, a `..` segment, or a symlink target pointing outside
+// dest -- is rejected rather than extracted (this is the "zip-slip"
+// vulnerability class). opts' MaxUncompressedBytes and MaxFiles bound the
+// work Unzip will do, guarding against zip bombs. Errors are returned
+// rather than fatal, so a bad entry can't bring down the whole process.
+func UnzipWithOptions(src, dest string, opts UnzipOptions) error {
 	r, err := zip.OpenReader(src)
 	if err != nil {
 		return err
 	}
 	defer r.Close()
 
+	destAbs, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+
+	if opts.MaxFiles > 0 && len(r.File) > opts.MaxFiles {
+		return fmt.Errorf("utils: zip contains %d entries, exceeding the limit of %d", len(r.File), opts.MaxFiles)
+	}
+
+	var totalUncompressed int64
 	for _, f := range r.File {
-		rc, err := f.Open()
+		fpath, err := safeJoin(destAbs, f.Name)
 		if err != nil {
 			return err
 		}
-		defer rc.Close()
 
-		fpath := filepath.Join(dest, f.Name)
 		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, f.Mode())
-		} else {
-			var fdir string
-			if lastIndex := strings.LastIndex(fpath, string(os.PathSeparator)); lastIndex > -1 {
-				fdir = fpath[:lastIndex]
+			if err := os.MkdirAll(fpath, f.Mode()); err != nil {
+				return err
 			}
+			continue
+		}
+
+		totalUncompressed += int64(f.UncompressedSize64)
+		if opts.MaxUncompressedBytes > 0 && totalUncompressed > opts.MaxUncompressedBytes {
+			return fmt.Errorf("utils: zip uncompressed size exceeds the limit of %d bytes", opts.MaxUncompressedBytes)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			return err
+		}
 
-			err = os.MkdirAll(fdir, f.Mode())
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+
+		if f.Mode()&os.ModeSymlink != 0 {
+			target, err := ioutil.ReadAll(rc)
+			rc.Close()
 			if err != nil {
-				log.Fatal(err)
 				return err
 			}
-			f, err := os.OpenFile(
-				fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-			if err != nil {
-				return err
+			if _, err := safeSymlinkJoin(destAbs, f.Name, string(target)); err != nil {
+				return fmt.Errorf("utils: symlink entry %q escapes %s: %s", f.Name, dest, err)
 			}
-			defer f.Close()
-
-			_, err = io.Copy(f, rc)
-			if err != nil {
+			os.Remove(fpath)
+			if err := os.Symlink(string(target), fpath); err != nil {
 				return err
 			}
+			continue
+		}
+
+		out, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		if err != nil {
+			rc.Close()
+			return err
+		}
+
+		_, err = io.Copy(out, rc)
+		rc.Close()
+		out.Close()
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+// safeJoin cleans name, joins it onto destAbs, and rejects the result if it
+// doesn't stay under destAbs. An absolute path or a `..` segment in name
+// would otherwise let an archive entry escape the extraction directory
+// entirely (the "zip-slip" vulnerability).
+func safeJoin(destAbs, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("utils: entry %q has an absolute path", name)
+	}
+
+	cleaned := filepath.Join(destAbs, name)
+	if cleaned != destAbs && !strings.HasPrefix(cleaned, destAbs+string(os.PathSeparator)) {
+		return "", fmt.Errorf("utils: entry %q escapes destination %q", name, destAbs)
+	}
+
+	return cleaned, nil
+}
+
+// safeSymlinkJoin validates a symlink entry's target the same way safeJoin
+// validates a regular entry's path. An absolute target is rejected
+// outright: filepath.Join silently demotes an absolute second argument to a
+// relative one (filepath.Join(".", "/etc/passwd") == "etc/passwd"), so
+// joining first and calling safeJoin on the result would let an absolute
+// symlink target sail through the "resolves inside dest" check and then
+// create a real symlink pointing outside dest. A relative target is joined
+// onto the entry's own directory and checked like any other entry path.
+func safeSymlinkJoin(destAbs, name, target string) (string, error) {
+	if filepath.IsAbs(target) {
+		return "", fmt.Errorf("utils: entry %q has a symlink target with an absolute path", name)
+	}
+
+	return safeJoin(destAbs, filepath.Join(filepath.Dir(name), target))
+}
@@ -0,0 +1,67 @@
+package utils
+
+import "testing"
+
+func TestSafeJoinRejectsEscapes(t *testing.T) {
+	destAbs := "/var/lib/lambda-scheduler/func1"
+
+	tests := []struct {
+		name    string
+		entry   string
+		wantErr bool
+	}{
+		{name: "plain file", entry: "bootstrap"},
+		{name: "nested file", entry: "lib/bootstrap"},
+		{name: "dot segment that stays inside", entry: "./lib/bootstrap"},
+		{name: "parent traversal", entry: "../../etc/passwd", wantErr: true},
+		{name: "parent traversal nested", entry: "lib/../../etc/passwd", wantErr: true},
+		{name: "absolute path", entry: "/etc/passwd", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := safeJoin(destAbs, tt.entry)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("safeJoin(%q, %q) = %q, want error", destAbs, tt.entry, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("safeJoin(%q, %q) returned unexpected error: %s", destAbs, tt.entry, err)
+			}
+		})
+	}
+}
+
+func TestSafeSymlinkJoinRejectsEscapes(t *testing.T) {
+	destAbs := "/var/lib/lambda-scheduler/func1"
+
+	tests := []struct {
+		name    string
+		entry   string
+		target  string
+		wantErr bool
+	}{
+		{name: "relative target staying inside", entry: "link", target: "bootstrap"},
+		{name: "relative target into subdir", entry: "sub/link", target: "../bootstrap"},
+		{name: "absolute target", entry: "link", target: "/etc/passwd", wantErr: true},
+		{name: "relative target escaping dest", entry: "link", target: "../../../etc/passwd", wantErr: true},
+		{name: "nested relative target escaping dest", entry: "sub/link", target: "../../../etc/passwd", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := safeSymlinkJoin(destAbs, tt.entry, tt.target)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("safeSymlinkJoin(%q, %q, %q) = %q, want error", destAbs, tt.entry, tt.target, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("safeSymlinkJoin(%q, %q, %q) returned unexpected error: %s", destAbs, tt.entry, tt.target, err)
+			}
+		})
+	}
+}